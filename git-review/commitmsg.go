@@ -0,0 +1,243 @@
+// Copyright 2014 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	maxSubjectLen  = 76
+	maxBodyLineLen = 76
+)
+
+// allowWipEnv, when set to a non-empty value, allows a commit subject
+// starting with WIP/fixup!/squash! that hookCommitMsg would otherwise
+// reject.
+const allowWipEnv = "GIT_REVIEW_ALLOW_WIP"
+
+var wipPrefixRE = regexp.MustCompile(`(?i)^(wip\b|fixup!|squash!)`)
+
+// mergeOrRevertRE matches the subjects git synthesizes for merge and
+// revert commits ("Merge branch 'x'", "Merge pull request #42 from ...",
+// `Revert "add a feature"`), which are exempt from the pkg:/wording
+// conventions below since the author didn't write them.
+var mergeOrRevertRE = regexp.MustCompile(`^(Merge (branch|remote-tracking branch|pull request) |Revert ")`)
+
+// messageConfig holds the commit-message conventions enforced by
+// hookCommitMsg and cmdCheckMessage, as loaded from a .gitreview or
+// codereview.cfg file at the repo root.
+type messageConfig struct {
+	RequirePkgPrefix   bool
+	RequireSignedOffBy bool
+}
+
+// loadMessageConfig reads .gitreview or codereview.cfg from root,
+// preferring .gitreview when both exist. If neither is present, it
+// returns the default conventions: a pkg: subject prefix is required,
+// Signed-off-by is not.
+func loadMessageConfig(root string) messageConfig {
+	cfg := messageConfig{RequirePkgPrefix: true}
+	for _, name := range []string{".gitreview", "codereview.cfg"} {
+		data, err := ioutil.ReadFile(filepath.Join(root, name))
+		if err != nil {
+			continue
+		}
+		parseMessageConfig(string(data), &cfg)
+		break
+	}
+	return cfg
+}
+
+// parseMessageConfig reads "key = value" lines (ignoring blank lines,
+// "#" comments, and "[section]" headers) and applies the recognized
+// keys to cfg.
+func parseMessageConfig(data string, cfg *messageConfig) {
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "[") {
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(parts[0]))
+		value := strings.TrimSpace(parts[1])
+		truthy := value == "true" || value == "1" || value == "yes"
+		switch key {
+		case "require-pkg-prefix":
+			cfg.RequirePkgPrefix = truthy
+		case "require-signed-off-by":
+			cfg.RequireSignedOffBy = truthy
+		}
+	}
+}
+
+// repoTopLevelDirs lists the non-hidden top-level directories of root,
+// used as the set of valid pkg: subject prefixes.
+func repoTopLevelDirs(root string) []string {
+	entries, err := ioutil.ReadDir(root)
+	if err != nil {
+		return nil
+	}
+	var dirs []string
+	for _, e := range entries {
+		if e.IsDir() && !strings.HasPrefix(e.Name(), ".") {
+			dirs = append(dirs, e.Name())
+		}
+	}
+	return dirs
+}
+
+// validateMessage checks a raw commit message against the repo's
+// conventions, returning one human-readable problem string per
+// violation (nil if msg is acceptable). pkgPrefixes is the set of valid
+// pkg: subject prefixes; committerIdent is "Name <email>" taken from
+// GIT_COMMITTER_IDENT.
+func validateMessage(msg []byte, cfg messageConfig, pkgPrefixes []string, committerIdent string) []string {
+	var body []string
+	for _, line := range strings.Split(strings.TrimRight(string(msg), "\n"), "\n") {
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		body = append(body, line)
+	}
+	for len(body) > 0 && body[len(body)-1] == "" {
+		body = body[:len(body)-1]
+	}
+	if len(body) == 0 {
+		return []string{"commit message is empty"}
+	}
+
+	var problems []string
+	subject := body[0]
+
+	// Merge and revert commits get their subject from git itself, not
+	// from the author, so the pkg:/wording conventions below don't
+	// apply to them.
+	if mergeOrRevertRE.MatchString(subject) {
+		return nil
+	}
+
+	if os.Getenv(allowWipEnv) == "" && wipPrefixRE.MatchString(subject) {
+		problems = append(problems, fmt.Sprintf("subject must not start with WIP/fixup!/squash! (set %s=1 to override)", allowWipEnv))
+	}
+	if len(subject) > maxSubjectLen {
+		problems = append(problems, fmt.Sprintf("subject line is %d characters, want <= %d", len(subject), maxSubjectLen))
+	}
+	if strings.HasSuffix(subject, ".") {
+		problems = append(problems, "subject line must not end in a period")
+	}
+	if cfg.RequirePkgPrefix && !hasPkgPrefix(subject, pkgPrefixes) {
+		problems = append(problems, fmt.Sprintf("subject must start with one of: %s", joinPkgPrefixes(pkgPrefixes)))
+	}
+
+	if len(body) > 1 {
+		if body[1] != "" {
+			problems = append(problems, "missing blank line between subject and body")
+		}
+		for _, line := range body[2:] {
+			if len(line) > maxBodyLineLen && !isQuotedOrURLLine(line) {
+				problems = append(problems, fmt.Sprintf("body line exceeds %d characters: %q", maxBodyLineLen, line))
+			}
+		}
+	}
+
+	if cfg.RequireSignedOffBy {
+		want := "Signed-off-by: " + committerIdent
+		if !containsLine(body, want) {
+			problems = append(problems, "missing "+want)
+		}
+	}
+
+	return problems
+}
+
+// hasPkgPrefix reports whether the text of subject before its first ":"
+// is one of pkgs. No space is required after the colon.
+func hasPkgPrefix(subject string, pkgs []string) bool {
+	i := strings.Index(subject, ":")
+	if i < 0 {
+		return false
+	}
+	prefix := subject[:i]
+	for _, pkg := range pkgs {
+		if prefix == pkg {
+			return true
+		}
+	}
+	return false
+}
+
+func joinPkgPrefixes(pkgs []string) string {
+	labeled := make([]string, len(pkgs))
+	for i, pkg := range pkgs {
+		labeled[i] = pkg + ":"
+	}
+	return strings.Join(labeled, ", ")
+}
+
+// isQuotedOrURLLine reports whether line is quoted text or contains a
+// URL, either of which is exempt from the body line length limit.
+func isQuotedOrURLLine(line string) bool {
+	return strings.HasPrefix(strings.TrimSpace(line), ">") || strings.Contains(line, "://")
+}
+
+func containsLine(lines []string, want string) bool {
+	for _, line := range lines {
+		if line == want {
+			return true
+		}
+	}
+	return false
+}
+
+// identName strips the timestamp and timezone that GIT_COMMITTER_IDENT
+// appends after the closing "<email>", leaving "Name <email>".
+func identName(ident string) string {
+	if i := strings.Index(ident, "> "); i >= 0 {
+		return ident[:i+1]
+	}
+	return ident
+}
+
+// cmdCheckMessage implements "git-review check-message <file>": it runs
+// the same conventions hookCommitMsg enforces against an arbitrary
+// message file, printing each violation to stderr and exiting non-zero
+// if there are any, so editors and CI can run the checks outside of a
+// commit-msg hook invocation.
+func cmdCheckMessage(args []string) {
+	if len(args) != 1 {
+		dief("usage: git-review check-message <file>")
+	}
+	data, err := ioutil.ReadFile(args[0])
+	if err != nil {
+		dief("%v", err)
+	}
+	clean, err := stripMessageComments(data)
+	if err != nil {
+		clean = data
+	}
+
+	paths := gitPaths()
+	cfg := loadMessageConfig(paths.RepoRoot)
+	committer, _ := runGit("var", "GIT_COMMITTER_IDENT")
+
+	problems := validateMessage(clean, cfg, repoTopLevelDirs(paths.RepoRoot), identName(committer))
+	for _, p := range problems {
+		fmt.Fprintln(os.Stderr, "commit message: "+p)
+	}
+	if len(problems) > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright 2014 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateMessage(t *testing.T) {
+	cfg := messageConfig{RequirePkgPrefix: true}
+	pkgs := []string{"git-review"}
+
+	cases := []struct {
+		name    string
+		msg     string
+		wantErr string // substring expected somewhere in the problems, "" means no problems
+	}{
+		{
+			name: "ok",
+			msg:  "git-review: add a feature\n\nExplains why.\n",
+		},
+		{
+			name:    "missing pkg prefix",
+			msg:     "add a feature\n\nExplains why.\n",
+			wantErr: "must start with one of",
+		},
+		{
+			name:    "subject too long",
+			msg:     "git-review: " + strings.Repeat("x", 70) + "\n\nbody\n",
+			wantErr: "want <= 76",
+		},
+		{
+			name:    "subject ends in period",
+			msg:     "git-review: add a feature.\n\nbody\n",
+			wantErr: "must not end in a period",
+		},
+		{
+			name:    "missing blank line",
+			msg:     "git-review: add a feature\nbody immediately follows\n",
+			wantErr: "blank line",
+		},
+		{
+			name:    "wip prefix",
+			msg:     "WIP add a feature\n\nbody\n",
+			wantErr: "WIP/fixup!/squash!",
+		},
+		{
+			name: "long URL line is exempt",
+			msg:  "git-review: add a feature\n\nSee https://" + strings.Repeat("x", 80) + " for details.\n",
+		},
+		{
+			name: "merge commit is exempt",
+			msg:  "Merge branch 'feature'\n",
+		},
+		{
+			name: "revert commit is exempt",
+			msg:  "Revert \"git-review: add a feature\"\n\nThis reverts commit abc123.\n",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			problems := validateMessage([]byte(tc.msg), cfg, pkgs, "Test Author <author@example.com>")
+			if tc.wantErr == "" {
+				if len(problems) != 0 {
+					t.Fatalf("validateMessage(%q) = %v, want no problems", tc.msg, problems)
+				}
+				return
+			}
+			found := false
+			for _, p := range problems {
+				if strings.Contains(p, tc.wantErr) {
+					found = true
+				}
+			}
+			if !found {
+				t.Fatalf("validateMessage(%q) = %v, want a problem containing %q", tc.msg, problems, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateMessageRequireSignedOffBy(t *testing.T) {
+	cfg := messageConfig{RequireSignedOffBy: true}
+	ident := "Test Author <author@example.com>"
+
+	missing := validateMessage([]byte("add a feature\n\nbody\n"), cfg, nil, ident)
+	if !containsLine(missing, "missing Signed-off-by: "+ident) {
+		t.Fatalf("expected missing Signed-off-by problem, got %v", missing)
+	}
+
+	ok := validateMessage([]byte("add a feature\n\nbody\n\nSigned-off-by: "+ident+"\n"), cfg, nil, ident)
+	if len(ok) != 0 {
+		t.Fatalf("validateMessage with matching Signed-off-by = %v, want no problems", ok)
+	}
+}
+
+func TestParseMessageConfig(t *testing.T) {
+	cfg := messageConfig{RequirePkgPrefix: true}
+	parseMessageConfig("[gerrit]\nhost=example.com\nrequire-pkg-prefix = false\nrequire-signed-off-by=true\n", &cfg)
+	if cfg.RequirePkgPrefix {
+		t.Errorf("RequirePkgPrefix = true, want false")
+	}
+	if !cfg.RequireSignedOffBy {
+		t.Errorf("RequireSignedOffBy = false, want true")
+	}
+}
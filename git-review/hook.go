@@ -5,59 +5,111 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"crypto/rand"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"strings"
 )
 
-var hookPath = ".git/hooks/"
+// hookFiles is the full set of client-side hooks git-review manages, in
+// the order git itself would invoke them over a commit's lifecycle.
 var hookFiles = []string{
+	"pre-commit",
+	"prepare-commit-msg",
 	"commit-msg",
+	"pre-push",
+	"post-merge",
 }
 
 func installHook() {
 	for _, hookFile := range hookFiles {
-		filename := filepath.Join(repoRoot(), hookPath+hookFile)
-
-		// Special case: remove old commit-msg shell script
-		// in favor of invoking the git-review hook implementation,
-		// which will be easier to change in the future.
-		if hookFile == "commit-msg" {
-			data, err := ioutil.ReadFile(filename)
-			if err == nil && string(data) == oldCommitMsgHook {
-				verbosef("removing old commit-msg hook")
-				os.Remove(filename)
-			}
-		}
+		installOneHook(hookFile, false)
+	}
+}
 
-		hookContent := fmt.Sprintf(hookScript, hookFile)
+// installOneHook writes hookFile's hookScript wrapper into the repo's
+// hooks directory. If the hook already exists with the expected content,
+// it does nothing. If it exists with different content, it is left alone
+// unless force is set, in which case it is overwritten. It reports
+// whether it wrote the file.
+func installOneHook(hookFile string, force bool) bool {
+	filename := filepath.Join(gitPaths().HooksDir, hookFile)
 
-		// If hook file exists, assume it is okay.
-		_, err := os.Stat(filename)
-		if err == nil {
-			if *verbose > 0 {
-				data, err := ioutil.ReadFile(filename)
-				if err != nil {
-					verbosef("reading hook: %v", err)
-				} else if string(data) != hookContent {
-					verbosef("unexpected hook content in %s", filename)
-				}
-			}
-			continue
+	// Special case: remove old commit-msg shell script
+	// in favor of invoking the git-review hook implementation,
+	// which will be easier to change in the future.
+	if hookFile == "commit-msg" {
+		data, err := ioutil.ReadFile(filename)
+		if err == nil && string(data) == oldCommitMsgHook {
+			verbosef("removing old commit-msg hook")
+			os.Remove(filename)
 		}
+	}
 
-		if !os.IsNotExist(err) {
-			dief("checking hook: %v", err)
+	hookContent := fmt.Sprintf(hookScript, hookFile)
+
+	data, err := ioutil.ReadFile(filename)
+	switch {
+	case err == nil && string(data) == hookContent:
+		return false // already up to date
+	case err == nil && !force:
+		if *verbose > 0 {
+			verbosef("unexpected hook content in %s", filename)
 		}
+		return false
+	case err == nil:
+		verbosef("overwriting %s hook", hookFile)
+	case os.IsNotExist(err):
 		verbosef("installing %s hook", hookFile)
-		if err := ioutil.WriteFile(filename, []byte(hookContent), 0700); err != nil {
-			dief("writing hook: %v", err)
+	default:
+		dief("checking hook: %v", err)
+	}
+
+	if err := ioutil.WriteFile(filename, []byte(hookContent), 0700); err != nil {
+		dief("writing hook: %v", err)
+	}
+	return true
+}
+
+// cmdHooks implements "git-review hooks": it reports which of hookFiles
+// are installed, missing, or present with unexpected content, and with
+// --force rewrites every hook to match what installHook would write.
+func cmdHooks(args []string) {
+	force := false
+	for _, arg := range args {
+		if arg != "--force" {
+			dief("usage: git-review hooks [--force]")
+		}
+		force = true
+	}
+
+	hooksDir := gitPaths().HooksDir
+	for _, hookFile := range hookFiles {
+		if force {
+			installOneHook(hookFile, true)
+		}
+
+		filename := filepath.Join(hooksDir, hookFile)
+		hookContent := fmt.Sprintf(hookScript, hookFile)
+		data, err := ioutil.ReadFile(filename)
+		status := "missing"
+		switch {
+		case err == nil && string(data) == hookContent:
+			status = "installed"
+		case err == nil:
+			status = "installed (modified)"
+		case !os.IsNotExist(err):
+			dief("checking hook: %v", err)
 		}
+		fmt.Printf("%-20s %s\n", hookFile, status)
 	}
 }
 
@@ -81,6 +133,88 @@ func repoRoot() string {
 	}
 }
 
+// GitPaths holds the filesystem locations installHook and the hook
+// management commands need. Resolving them through gitPaths rather than
+// assuming <repoRoot>/.git/hooks keeps hook installation correct for
+// linked worktrees (whose hooks live in the main checkout's shared
+// hooks directory, not a per-worktree one), submodules (whose hooks are
+// their own, not inherited from the superproject), and GIT_DIR/
+// GIT_COMMON_DIR overrides.
+type GitPaths struct {
+	// RepoRoot is this checkout's working tree root.
+	RepoRoot string
+	// HooksDir is the hooks directory git will actually invoke hooks
+	// from for this checkout.
+	HooksDir string
+}
+
+// gitPaths resolves the GitPaths for the current directory. It prefers
+// `git rev-parse --show-toplevel`/`--git-path hooks`, which already
+// understand worktrees, submodules, and GIT_DIR/GIT_COMMON_DIR, and
+// falls back to parsing the .git file by hand when git itself cannot be
+// run (e.g. hook-invoke firing in a stripped-down environment).
+func gitPaths() GitPaths {
+	if _, err := exec.LookPath("git"); err == nil {
+		if root, err := runGit("rev-parse", "--show-toplevel"); err == nil {
+			hooksDir, err := runGit("rev-parse", "--git-path", "hooks")
+			if err != nil {
+				dief("resolving hooks directory: %v", err)
+			}
+			// --git-path returns a path relative to the current working
+			// directory, not to --show-toplevel: join against cwd, not
+			// root, or this is wrong whenever run from a subdirectory.
+			if !filepath.IsAbs(hooksDir) {
+				cwd, err := os.Getwd()
+				if err != nil {
+					dief("could not get current directory: %v", err)
+				}
+				hooksDir = filepath.Join(cwd, hooksDir)
+			}
+			return GitPaths{RepoRoot: filepath.Clean(root), HooksDir: filepath.Clean(hooksDir)}
+		}
+	}
+	return gitPathsManual(repoRoot())
+}
+
+// gitPathsManual resolves HooksDir by reading root/.git directly, for
+// use when the git binary isn't available. It handles a plain
+// repository (.git is a directory), a linked worktree (.git is a file
+// containing "gitdir: <path>" pointing under .git/worktrees/<name>,
+// whose hooks are shared from the main checkout two directories up),
+// and a submodule (.git is a file pointing under .git/modules/<name>,
+// which has its own hooks, not shared with the superproject). It does
+// not honor GIT_DIR/GIT_COMMON_DIR overrides; those require git itself.
+func gitPathsManual(root string) GitPaths {
+	dotGit := filepath.Join(root, ".git")
+	info, err := os.Stat(dotGit)
+	if err != nil {
+		dief("resolving %s: %v", dotGit, err)
+	}
+	if info.IsDir() {
+		return GitPaths{RepoRoot: root, HooksDir: filepath.Join(dotGit, "hooks")}
+	}
+
+	data, err := ioutil.ReadFile(dotGit)
+	if err != nil {
+		dief("reading %s: %v", dotGit, err)
+	}
+	const gitdirPrefix = "gitdir: "
+	line := strings.TrimSpace(string(data))
+	if !strings.HasPrefix(line, gitdirPrefix) {
+		dief("unrecognized .git file: %s", dotGit)
+	}
+	gitDir := strings.TrimPrefix(line, gitdirPrefix)
+	if !filepath.IsAbs(gitDir) {
+		gitDir = filepath.Join(root, gitDir)
+	}
+	gitDir = filepath.Clean(gitDir)
+
+	if parent := filepath.Dir(gitDir); filepath.Base(parent) == "worktrees" {
+		gitDir = filepath.Dir(parent)
+	}
+	return GitPaths{RepoRoot: root, HooksDir: filepath.Join(gitDir, "hooks")}
+}
+
 var hookScript = `#!/bin/sh
 exec git-review hook-invoke %s "$@"
 `
@@ -92,7 +226,185 @@ func hookInvoke(args []string) {
 	switch args[0] {
 	case "commit-msg":
 		hookCommitMsg(args[1:])
+	case "pre-commit":
+		hookPreCommit(args[1:])
+	case "prepare-commit-msg":
+		hookPrepareCommitMsg(args[1:])
+	case "pre-push":
+		hookPrePush(args[1:])
+	case "post-merge":
+		hookPostMerge(args[1:])
+	}
+}
+
+// skipPreCommitEnv, when set to a non-empty value, skips the gofmt/go vet
+// checks hookPreCommit would otherwise run.
+const skipPreCommitEnv = "GIT_REVIEW_SKIP_PRECOMMIT"
+
+// hookPreCommit is installed as the git pre-commit hook. It rejects the
+// commit if any staged .go file is not gofmt-clean or if go vet finds
+// problems, unless skipPreCommitEnv is set.
+func hookPreCommit(args []string) {
+	if os.Getenv(skipPreCommitEnv) != "" {
+		return
+	}
+
+	staged, err := runGit("diff", "--cached", "--name-only", "--diff-filter=ACM")
+	if err != nil {
+		dief("listing staged files: %v", err)
+	}
+	var goFiles []string
+	for _, f := range strings.Split(staged, "\n") {
+		if strings.HasSuffix(f, ".go") {
+			goFiles = append(goFiles, f)
+		}
+	}
+	if len(goFiles) == 0 {
+		return
+	}
+
+	out, err := exec.Command("gofmt", append([]string{"-l"}, goFiles...)...).Output()
+	if err != nil {
+		dief("running gofmt: %v", err)
+	}
+	if len(bytes.TrimSpace(out)) > 0 {
+		dief("gofmt found unformatted files, run gofmt -w:\n%s(set %s=1 to commit anyway)\n", out, skipPreCommitEnv)
+	}
+
+	if out, err := exec.Command("go", "vet", "./...").CombinedOutput(); err != nil {
+		dief("go vet found problems:\n%s(set %s=1 to commit anyway)\n", out, skipPreCommitEnv)
+	}
+}
+
+// issueBranchRE matches branch names of the form used for per-issue work,
+// e.g. issue/1234.
+var issueBranchRE = regexp.MustCompile(`^issue/(\d+)$`)
+
+// hookPrepareCommitMsg is installed as the git prepare-commit-msg hook.
+// When git invoked it for a plain `git commit` (no merge, squash, or
+// template message already in play) and the current branch looks like
+// issue/1234, it seeds the message with a subject line naming the issue.
+func hookPrepareCommitMsg(args []string) {
+	if len(args) < 1 {
+		dief("usage: git-review hook-invoke prepare-commit-msg msgfile [source [sha]]")
+	}
+	if len(args) >= 2 && args[1] != "" {
+		return
+	}
+	branch, err := runGit("rev-parse", "--abbrev-ref", "HEAD")
+	if err != nil {
+		return
+	}
+	m := issueBranchRE.FindStringSubmatch(branch)
+	if m == nil {
+		return
+	}
+	data, err := ioutil.ReadFile(args[0])
+	if err != nil {
+		dief("%v", err)
+	}
+	data = append([]byte(fmt.Sprintf("issue/%s: \n\n", m[1])), data...)
+	if err := ioutil.WriteFile(args[0], data, 0666); err != nil {
+		dief("%v", err)
+	}
+}
+
+// zeroSha is the all-zeroes object name git uses in pre-push/post-receive
+// input to mean "this ref doesn't exist".
+const zeroSha = "0000000000000000000000000000000000000000"
+
+// hookPrePush is installed as the git pre-push hook. It reads the
+// "<local ref> <local sha1> <remote ref> <remote sha1>" lines git feeds it
+// on stdin and refuses the push if any commit being pushed — not just the
+// tip of each ref — lacks a Change-Id trailer or has an over-long subject
+// line.
+func hookPrePush(args []string) {
+	var remoteName string
+	if len(args) > 0 {
+		remoteName = args[0]
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 4 {
+			continue
+		}
+		localRef, localSha, _, remoteSha := fields[0], fields[1], fields[2], fields[3]
+		if localSha == zeroSha {
+			continue // deleting the remote ref, nothing to check
+		}
+
+		commits, err := commitsToPush(localSha, remoteSha, remoteName)
+		if err != nil {
+			dief("listing commits to push for %s: %v", localRef, err)
+		}
+		problems, err := checkPushCommits(commits)
+		if err != nil {
+			dief("%v", err)
+		}
+		for _, p := range problems {
+			dief("refusing to push %s: %s", localRef, p)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		dief("reading pre-push input: %v", err)
+	}
+}
+
+// commitsToPush lists the commits a pre-push invocation for one ref
+// update is about to push: everything in remoteSha..localSha, or, for a
+// brand new ref (remoteSha is zeroSha), everything reachable from
+// localSha that isn't already on one of the remote's tracking refs.
+func commitsToPush(localSha, remoteSha, remoteName string) ([]string, error) {
+	args := []string{"rev-list"}
+	switch {
+	case remoteSha != zeroSha:
+		args = append(args, remoteSha+".."+localSha)
+	case remoteName != "":
+		args = append(args, localSha, "--not", "--remotes="+remoteName)
+	default:
+		args = append(args, localSha)
+	}
+	out, err := runGit(args...)
+	if err != nil {
+		return nil, err
+	}
+	if out == "" {
+		return nil, nil
 	}
+	return strings.Split(out, "\n"), nil
+}
+
+// checkPushCommits returns one problem string per commit in commits that
+// lacks a Change-Id trailer or has an over-long subject line.
+func checkPushCommits(commits []string) ([]string, error) {
+	var problems []string
+	for _, sha := range commits {
+		msg, err := runGit("log", "-1", "--format=%B", sha)
+		if err != nil {
+			return nil, fmt.Errorf("reading commit message for %s: %v", sha, err)
+		}
+		if !strings.Contains("\n"+msg+"\n", "\nChange-Id: ") {
+			problems = append(problems, fmt.Sprintf("commit %s has no Change-Id trailer", sha[:12]))
+			continue
+		}
+		subject := msg
+		if i := strings.Index(msg, "\n"); i >= 0 {
+			subject = msg[:i]
+		}
+		if len(subject) > maxSubjectLen {
+			problems = append(problems, fmt.Sprintf("commit %s subject is %d characters, want <= %d", sha[:12], len(subject), maxSubjectLen))
+		}
+	}
+	return problems, nil
+}
+
+// hookPostMerge is installed as the git post-merge hook. It re-runs
+// installHook so that hooks added to hookFiles in a newer git-review
+// propagate to this checkout after pulling or switching branches.
+func hookPostMerge(args []string) {
+	installHook()
 }
 
 // hookCommitMsg is installed as the git commit-msg hook.
@@ -108,21 +420,233 @@ func hookCommitMsg(args []string) {
 	if err != nil {
 		dief("%v", err)
 	}
+
+	// validateMessage and insertChangeId both see the message with
+	// comments and diff dump stripped, not the raw file: `git commit -v`
+	// (or a plain interactive commit) leaves a "# comment" block and a
+	// trailing `diff --git a/` dump below the user's message, and neither
+	// is part of what's actually being committed. Signed-off-by lines
+	// are kept.
+	clean, err := stripMessageComments(data)
+	if err != nil {
+		verbosef("cleaning commit message: %v; using raw message", err)
+		clean = data
+	}
+
+	paths := gitPaths()
+	cfg := loadMessageConfig(paths.RepoRoot)
+	committer, _ := runGit("var", "GIT_COMMITTER_IDENT")
+	if problems := validateMessage(clean, cfg, repoTopLevelDirs(paths.RepoRoot), identName(committer)); len(problems) > 0 {
+		for _, p := range problems {
+			fmt.Fprintln(os.Stderr, "commit-msg: "+p)
+		}
+		dief("commit message does not meet repo conventions; see above")
+	}
+
 	if bytes.Contains(data, []byte("\nChange-Id: ")) {
 		return
 	}
-	n := len(data)
-	for n > 0 && data[n-1] == '\n' {
-		n--
+	id, err := genChangeId(data)
+	if err != nil {
+		// git write-tree (or one of the other plumbing commands) failed,
+		// most likely because we are not inside a work tree. Fall back
+		// to a random Change-Id rather than failing the commit outright.
+		verbosef("generating deterministic Change-Id: %v; using random Change-Id", err)
+		id = randomChangeId()
+	}
+
+	data = insertChangeId(clean, id)
+	if err := ioutil.WriteFile(file, data, 0666); err != nil {
+		dief("%v", err)
+	}
+}
+
+// changeIdAfter lists, as a regexp alternation, the trailer keys that a
+// Change-Id line should be inserted before rather than after. It takes
+// its name from the CHANGE_ID_AFTER variable in the old shell hook, which
+// used its list the other way round: the shell hook placed Change-Id
+// after leading Bug:/Issue: lines.
+var changeIdAfter = "Bug|Issue|Fixes"
+
+var (
+	trailerLineRE   = regexp.MustCompile(`^[a-zA-Z0-9-]+:`)
+	urlSchemeRE     = regexp.MustCompile(`^[a-z0-9-]+://`)
+	signedOffByRE   = regexp.MustCompile(`(?m)^Signed-off-by:.*\n?`)
+	commentLineRE   = regexp.MustCompile(`(?m)^#.*\n?`)
+	diffGitHeaderRE = regexp.MustCompile(`(?m)^diff --git a/`)
+)
+
+// genChangeId computes a deterministic Change-Id for msg the same way the
+// old Gerrit commit-msg shell hook did: it hashes a synthetic commit object
+// built from the current tree, the current HEAD as parent (if any), the
+// author and committer identities, and the cleaned-up commit message.
+//
+// The id is a function of its inputs rather than a fresh random value:
+// the same tree, parent, message and author and committer identities
+// give the same id. Both identities carry a timestamp, and the committer
+// one is the current time, so a later run (e.g. after `commit --amend`
+// or a cherry-pick) normally yields a different id.
+func genChangeId(msg []byte) (string, error) {
+	clean, err := cleanCommitMessage(msg)
+	if err != nil {
+		return "", err
+	}
+	if len(bytes.TrimSpace(clean)) == 0 {
+		return "", fmt.Errorf("empty commit message")
+	}
+
+	tree, err := runGit("write-tree")
+	if err != nil {
+		return "", err
+	}
+	author, err := runGit("var", "GIT_AUTHOR_IDENT")
+	if err != nil {
+		return "", err
+	}
+	committer, err := runGit("var", "GIT_COMMITTER_IDENT")
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "tree %s\n", tree)
+	if parent, err := runGit("rev-parse", "HEAD^0"); err == nil {
+		fmt.Fprintf(&buf, "parent %s\n", parent)
+	}
+	fmt.Fprintf(&buf, "author %s\n", author)
+	fmt.Fprintf(&buf, "committer %s\n", committer)
+	buf.WriteString("\n")
+	// The shell hook printed the message from a command substitution,
+	// which drops trailing newlines.
+	buf.Write(bytes.TrimRight(clean, "\n"))
+
+	sum, err := runGitStdin(buf.Bytes(), "hash-object", "-t", "commit", "--stdin")
+	if err != nil {
+		return "", err
 	}
+	return "I" + sum, nil
+}
+
+// cleanCommitMessage strips the parts of a raw commit message file that
+// should not feed into the Change-Id hash: Signed-off-by trailers, #
+// comment lines, and anything from the `diff --git a/` patch dump onward
+// (present when the editor was invoked with `commit -v`). The result is
+// then run through `git stripspace` like the shell hook did.
+func cleanCommitMessage(msg []byte) ([]byte, error) {
+	text := string(msg)
+	if loc := diffGitHeaderRE.FindStringIndex(text); loc != nil {
+		text = text[:loc[0]]
+	}
+	text = signedOffByRE.ReplaceAllString(text, "")
+	text = commentLineRE.ReplaceAllString(text, "")
+	return runGitStdinRaw([]byte(text), "stripspace")
+}
+
+// stripMessageComments strips the parts of a raw commit message file that
+// are not committed: # comment lines and anything from the
+// `diff --git a/` patch dump onward. Unlike cleanCommitMessage it keeps
+// Signed-off-by trailers. The result is run through `git stripspace`.
+func stripMessageComments(msg []byte) ([]byte, error) {
+	text := string(msg)
+	if loc := diffGitHeaderRE.FindStringIndex(text); loc != nil {
+		text = text[:loc[0]]
+	}
+	text = commentLineRE.ReplaceAllString(text, "")
+	return runGitStdinRaw([]byte(text), "stripspace")
+}
+
+// randomChangeId is the fallback used when genChangeId cannot compute a
+// deterministic id, e.g. because hook-invoke was run outside a work tree.
+func randomChangeId() string {
 	var id [20]byte
 	if _, err := io.ReadFull(rand.Reader, id[:]); err != nil {
 		dief("generating Change-Id: %v", err)
 	}
-	data = append(data[:n], fmt.Sprintf("\n\nChange-Id: I%x\n", id[:])...)
-	if err := ioutil.WriteFile(file, data, 0666); err != nil {
-		dief("%v", err)
+	return fmt.Sprintf("I%x", id[:])
+}
+
+// insertChangeId inserts a "Change-Id: <id>" trailer into data's footer
+// block, right before the first trailer matching changeIdAfter (by
+// default Bug:, Issue: and Fixes:), or at the end of the footer if none
+// matches; trailer lines after that first match stay after Change-Id.
+// The footer is found the same way the old shell hook's perl logic found
+// it, but the shell hook placed Change-Id after leading Bug:/Issue: lines.
+func insertChangeId(data []byte, id string) []byte {
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+
+	// Find the blank line that starts an existing trailer/footer block,
+	// scanning upward from the end the same way the old shell hook did:
+	// trailer lines and their indented continuations belong to the
+	// footer, and the blank line immediately above the first trailer
+	// line marks where the footer begins.
+	haveFooter := false
+	footerStart := -1
+	for i := len(lines) - 1; i >= 0; i-- {
+		line := lines[i]
+		if trailerLineRE.MatchString(line) && !urlSchemeRE.MatchString(line) {
+			haveFooter = true
+			continue
+		}
+		if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "[") {
+			continue
+		}
+		if haveFooter && strings.TrimSpace(line) == "" {
+			footerStart = i
+		}
+		break
+	}
+
+	var message, footer []string
+	if footerStart >= 0 {
+		message = lines[:footerStart+1]
+		footer = append([]string{}, lines[footerStart+1:]...)
+	} else {
+		// No existing footer: keep the whole message as the body and
+		// add the blank line that separates it from the new trailer.
+		message = append(append([]string{}, lines...), "")
+	}
+
+	// Insert Change-Id right before the first trailer matching
+	// changeIdAfter (Bug:/Issue:/Fixes: by default), or at the end of the
+	// footer if none is present.
+	afterRE := regexp.MustCompile(`(?i)^(` + changeIdAfter + `):`)
+	insertAt := len(footer)
+	for i, line := range footer {
+		if afterRE.MatchString(line) {
+			insertAt = i
+			break
+		}
+	}
+	footer = append(footer[:insertAt:insertAt], append([]string{"Change-Id: " + id}, footer[insertAt:]...)...)
+
+	return []byte(strings.Join(append(message, footer...), "\n") + "\n")
+}
+
+// runGit runs git with args and returns its trimmed standard output.
+func runGit(args ...string) (string, error) {
+	out, err := runGitStdinRaw(nil, args...)
+	return strings.TrimSpace(string(out)), err
+}
+
+// runGitStdin runs git with args, feeding it stdin, and returns its
+// trimmed standard output.
+func runGitStdin(stdin []byte, args ...string) (string, error) {
+	out, err := runGitStdinRaw(stdin, args...)
+	return strings.TrimSpace(string(out)), err
+}
+
+// runGitStdinRaw runs git with args, feeding it stdin, and returns its
+// standard output unmodified.
+func runGitStdinRaw(stdin []byte, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", args...)
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s: %v", strings.Join(args, " "), err)
 	}
+	return out, nil
 }
 
 // This is NOT USED ANYMORE.
@@ -0,0 +1,412 @@
+// Copyright 2014 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// initTestRepo creates a throwaway git repository in a temp directory and
+// returns its path, along with a cleanup function.
+func initTestRepo(t *testing.T) string {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "git-review-hook-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	run := func(args ...string) {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	run("init", "-q", dir)
+	run("-C", dir, "config", "user.name", "Test Author")
+	run("-C", dir, "config", "user.email", "author@example.com")
+	// These tests exercise Change-Id/hook plumbing, not the subject
+	// pkg: prefix convention, which has no meaningful top-level
+	// directory to match in a throwaway repo.
+	if err := os.WriteFile(filepath.Join(dir, "codereview.cfg"), []byte("require-pkg-prefix = false\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "file.txt"), []byte("hello\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	run("-C", dir, "add", "file.txt")
+	run("-C", dir, "commit", "-q", "-m", "initial commit")
+	return dir
+}
+
+func withDir(t *testing.T, dir string, f func()) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	f()
+}
+
+func TestGenChangeIdDeterministic(t *testing.T) {
+	dir := initTestRepo(t)
+	msg := []byte("add a feature\n\nBody text.\n")
+	var id1, id2 string
+	withDir(t, dir, func() {
+		var err error
+		id1, err = genChangeId(msg)
+		if err != nil {
+			t.Fatalf("genChangeId: %v", err)
+		}
+		id2, err = genChangeId(msg)
+		if err != nil {
+			t.Fatalf("genChangeId: %v", err)
+		}
+	})
+	if id1 != id2 {
+		t.Fatalf("genChangeId not deterministic: %q != %q", id1, id2)
+	}
+	if !strings.HasPrefix(id1, "I") || len(id1) != 41 {
+		t.Fatalf("unexpected Change-Id shape: %q", id1)
+	}
+}
+
+// TestHookCommitMsgAmendPreservesId simulates the amend case: once a
+// Change-Id trailer is present in the message, re-running the hook must
+// leave it untouched rather than generating a new one.
+func TestHookCommitMsgAmendPreservesId(t *testing.T) {
+	dir := initTestRepo(t)
+	file := filepath.Join(dir, "COMMIT_EDITMSG")
+	original := []byte("add a feature\n\nChange-Id: Ideadbeef00000000000000000000000000000000\n")
+	if err := os.WriteFile(file, original, 0644); err != nil {
+		t.Fatal(err)
+	}
+	withDir(t, dir, func() {
+		hookCommitMsg([]string{file})
+	})
+	got, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(original) {
+		t.Fatalf("hookCommitMsg modified a message that already had a Change-Id:\nhave: %q\nwant: %q", got, original)
+	}
+}
+
+// TestHookCommitMsgTrailingComments reproduces the file git leaves behind
+// for an interactive `git commit` (no -m): the user's text followed by
+// git's standard instructional "#" comment block. The trailing comments
+// must not defeat insertChangeId's footer scan and push Change-Id after
+// an existing Bug: trailer.
+func TestHookCommitMsgTrailingComments(t *testing.T) {
+	dir := initTestRepo(t)
+	file := filepath.Join(dir, "COMMIT_EDITMSG")
+	original := []byte(`git-review: add a feature
+
+Explains why.
+
+Bug: 1234
+
+# Please enter the commit message for your changes. Lines starting
+# with '#' will be ignored, and an empty message aborts the commit.
+#
+# On branch main
+`)
+	if err := os.WriteFile(file, original, 0644); err != nil {
+		t.Fatal(err)
+	}
+	withDir(t, dir, func() {
+		hookCommitMsg([]string{file})
+	})
+	got, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changeIdIdx := strings.Index(string(got), "Change-Id: ")
+	bugIdx := strings.Index(string(got), "Bug: 1234")
+	if changeIdIdx == -1 || bugIdx == -1 {
+		t.Fatalf("expected both Change-Id and Bug: 1234 in output, got:\n%s", got)
+	}
+	if changeIdIdx > bugIdx {
+		t.Fatalf("Change-Id inserted after Bug: 1234, want before:\n%s", got)
+	}
+}
+
+// TestHookCommitMsgCherryPickPreservesId simulates a cherry-pick, which
+// carries the original commit message (Change-Id included) verbatim into
+// the new commit's message file; the hook must not rewrite it.
+func TestHookCommitMsgCherryPickPreservesId(t *testing.T) {
+	dir := initTestRepo(t)
+	file := filepath.Join(dir, "MERGE_MSG")
+	original := []byte("cherry-picked change\n\nChange-Id: Ifeedfacecafebeef00000000000000000000000\n")
+	if err := os.WriteFile(file, original, 0644); err != nil {
+		t.Fatal(err)
+	}
+	withDir(t, dir, func() {
+		hookCommitMsg([]string{file})
+	})
+	got, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(original) {
+		t.Fatalf("hookCommitMsg modified a cherry-picked Change-Id:\nhave: %q\nwant: %q", got, original)
+	}
+}
+
+// TestHookCommitMsgAllowsVerboseDiffTail reproduces `git commit -v`: the
+// message file git hands the hook carries a trailing `diff --git a/`
+// dump below the user's actual message. A long line in that diff must
+// not trip the body-line-length convention check, which only applies to
+// what the user wrote.
+func TestHookCommitMsgAllowsVerboseDiffTail(t *testing.T) {
+	dir := initTestRepo(t)
+	file := filepath.Join(dir, "COMMIT_EDITMSG")
+	original := []byte("git-review: add a feature\n\nExplains why.\n\n" +
+		"# Please enter the commit message for your changes. Lines starting\n" +
+		"# with '#' will be ignored, and an empty message aborts the commit.\n" +
+		"#\n" +
+		"diff --git a/file.txt b/file.txt\n" +
+		"index 0000000..1111111 100644\n" +
+		"--- a/file.txt\n" +
+		"+++ b/file.txt\n" +
+		"@@ -1 +1 @@\n" +
+		"-hello\n" +
+		"+" + strings.Repeat("x", 100) + "\n")
+	if err := os.WriteFile(file, original, 0644); err != nil {
+		t.Fatal(err)
+	}
+	withDir(t, dir, func() {
+		hookCommitMsg([]string{file})
+	})
+	got, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(got), "Change-Id: ") {
+		t.Fatalf("hookCommitMsg rejected a -v commit over a long diff line:\n%s", got)
+	}
+}
+
+// TestHookCommitMsgHonorsGitDirOverride runs the hook from outside any
+// working tree, relying solely on a GIT_DIR/GIT_WORK_TREE override to
+// locate the repo. The old repoRoot's bare .git walk would dief here;
+// gitPaths, backed by git rev-parse, must not.
+func TestHookCommitMsgHonorsGitDirOverride(t *testing.T) {
+	dir := initTestRepo(t)
+	outside, err := os.MkdirTemp("", "git-review-hook-test-outside")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(outside) })
+	t.Setenv("GIT_DIR", filepath.Join(dir, ".git"))
+	t.Setenv("GIT_WORK_TREE", dir)
+
+	file := filepath.Join(outside, "COMMIT_EDITMSG")
+	if err := os.WriteFile(file, []byte("git-review: add a feature\n\nExplains why.\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	withDir(t, outside, func() {
+		hookCommitMsg([]string{file})
+	})
+	got, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(got), "Change-Id: ") {
+		t.Fatalf("hookCommitMsg under a GIT_DIR override did not add a Change-Id:\n%s", got)
+	}
+}
+
+func TestInstallOneHookForce(t *testing.T) {
+	dir := initTestRepo(t)
+	hookFile := filepath.Join(dir, ".git", "hooks", "pre-commit")
+	if err := os.WriteFile(hookFile, []byte("#!/bin/sh\necho custom\n"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	withDir(t, dir, func() {
+		if wrote := installOneHook("pre-commit", false); wrote {
+			t.Fatalf("installOneHook(force=false) overwrote an existing hook")
+		}
+	})
+	got, err := os.ReadFile(hookFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "#!/bin/sh\necho custom\n" {
+		t.Fatalf("non-forced installOneHook changed hook content: %q", got)
+	}
+
+	withDir(t, dir, func() {
+		if wrote := installOneHook("pre-commit", true); !wrote {
+			t.Fatalf("installOneHook(force=true) did not overwrite an existing hook")
+		}
+	})
+	got, err = os.ReadFile(hookFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := fmt.Sprintf(hookScript, "pre-commit")
+	if string(got) != want {
+		t.Fatalf("forced installOneHook wrote %q, want %q", got, want)
+	}
+}
+
+func TestGitPathsLinkedWorktree(t *testing.T) {
+	main := initTestRepo(t)
+	wtDir := filepath.Join(filepath.Dir(main), filepath.Base(main)+"-wt")
+	run := func(args ...string) {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = main
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	run("worktree", "add", "-q", wtDir)
+	t.Cleanup(func() { os.RemoveAll(wtDir) })
+
+	mainHooks := filepath.Join(main, ".git", "hooks")
+
+	var got GitPaths
+	withDir(t, main, func() { got = gitPaths() })
+	if got.HooksDir != mainHooks {
+		t.Fatalf("gitPaths() from main checkout: HooksDir = %q, want %q", got.HooksDir, mainHooks)
+	}
+
+	withDir(t, wtDir, func() { got = gitPaths() })
+	if got.HooksDir != mainHooks {
+		t.Fatalf("gitPaths() from linked worktree: HooksDir = %q, want the shared %q", got.HooksDir, mainHooks)
+	}
+
+	// Installing from the worktree must land the hook in the shared
+	// hooks directory, visible from the main checkout too.
+	withDir(t, wtDir, func() { installOneHook("pre-commit", false) })
+	if _, err := os.Stat(filepath.Join(mainHooks, "pre-commit")); err != nil {
+		t.Fatalf("pre-commit hook not installed in shared hooks dir: %v", err)
+	}
+}
+
+func TestGitPathsFromSubdirectory(t *testing.T) {
+	dir := initTestRepo(t)
+	sub := filepath.Join(dir, "sub")
+	if err := os.Mkdir(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	wantHooks := filepath.Join(dir, ".git", "hooks")
+	var got GitPaths
+	withDir(t, sub, func() { got = gitPaths() })
+	if got.HooksDir != wantHooks {
+		t.Fatalf("gitPaths() from a subdirectory: HooksDir = %q, want %q", got.HooksDir, wantHooks)
+	}
+}
+
+func TestGitPathsManualWorktree(t *testing.T) {
+	main := initTestRepo(t)
+	wtDir := filepath.Join(filepath.Dir(main), filepath.Base(main)+"-wt-manual")
+	run := func(args ...string) {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = main
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	run("worktree", "add", "-q", wtDir)
+	t.Cleanup(func() { os.RemoveAll(wtDir) })
+
+	mainHooks := filepath.Join(main, ".git", "hooks")
+	got := gitPathsManual(wtDir)
+	if got.HooksDir != mainHooks {
+		t.Fatalf("gitPathsManual(worktree): HooksDir = %q, want %q", got.HooksDir, mainHooks)
+	}
+}
+
+// TestCheckPushCommitsWholeRange exercises the commit-message checks
+// hookPrePush relies on against every commit in a range, not just its
+// tip, since an earlier commit in a multi-commit push can lack a
+// Change-Id even when the tip has one.
+func TestCheckPushCommitsWholeRange(t *testing.T) {
+	dir := initTestRepo(t)
+	run := func(args ...string) string {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	base := run("rev-parse", "HEAD")
+	run("commit", "-q", "--allow-empty", "-m", "git-review: missing change id\n\nNo trailer here.")
+	missing := run("rev-parse", "HEAD")
+	run("commit", "-q", "--allow-empty", "-m", "git-review: add feature\n\nChange-Id: Ibbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb")
+	tip := run("rev-parse", "HEAD")
+
+	var commits []string
+	var err error
+	withDir(t, dir, func() {
+		commits, err = commitsToPush(tip, base, "")
+	})
+	if err != nil {
+		t.Fatalf("commitsToPush: %v", err)
+	}
+	if len(commits) != 2 {
+		t.Fatalf("commitsToPush(tip, base) = %v, want 2 commits", commits)
+	}
+
+	var problems []string
+	withDir(t, dir, func() {
+		problems, err = checkPushCommits(commits)
+	})
+	if err != nil {
+		t.Fatalf("checkPushCommits: %v", err)
+	}
+	if len(problems) != 1 || !strings.Contains(problems[0], missing[:12]) {
+		t.Fatalf("checkPushCommits(%v) = %v, want a single problem naming %s", commits, problems, missing[:12])
+	}
+}
+
+func TestInsertChangeIdOrdering(t *testing.T) {
+	cases := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "no footer",
+			in:   "subject line\n\nbody text.\n",
+			want: "subject line\n\nbody text.\n\nChange-Id: I0123\n",
+		},
+		{
+			name: "before Bug trailer",
+			in:   "subject line\n\nbody text.\n\nBug: 1234\n",
+			want: "subject line\n\nbody text.\n\nChange-Id: I0123\nBug: 1234\n",
+		},
+		{
+			name: "after Signed-off-by, before Issue",
+			in:   "subject line\n\nbody text.\n\nSigned-off-by: A <a@example.com>\nIssue: 42\n",
+			want: "subject line\n\nbody text.\n\nSigned-off-by: A <a@example.com>\nChange-Id: I0123\nIssue: 42\n",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := string(insertChangeId([]byte(tc.in), "I0123"))
+			if got != tc.want {
+				t.Fatalf("insertChangeId(%q) = %q, want %q", tc.in, got, tc.want)
+			}
+		})
+	}
+}